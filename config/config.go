@@ -0,0 +1,140 @@
+// Package config 负责加载水印配置文件（watermark.json / watermark.yaml），
+// 并在文件变化时通过 fsnotify 通知调用方重新生成水印。
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/fsnotify/fsnotify"
+	"gopkg.in/yaml.v3"
+)
+
+// Config 对应原来硬编码在 main.go 里的 watermarkConfig，外加水印文字模板，
+// 字段名导出以便 JSON/YAML 解析
+type Config struct {
+	Angle           float64 `json:"angle" yaml:"angle"`                     // 文字倾斜角度（负数表示向右倾斜）
+	ImageRotation   float64 `json:"imageRotation" yaml:"imageRotation"`     // 整体图片旋转角度（0-360度）
+	FontSize        float64 `json:"fontSize" yaml:"fontSize"`               // 字体大小（96 DPI 下的像素值，按显示器 DPI 等比放大）
+	SpaceCount      int     `json:"spaceCount" yaml:"spaceCount"`           // 文字与时间戳之间的空格数
+	Alpha           uint32  `json:"alpha" yaml:"alpha"`                     // 水印透明度 (0-255)
+	SpacingX        int     `json:"spacingX" yaml:"spacingX"`               // 水印水平间距（96 DPI 下实际步长为该值的 4/3 倍像素）
+	SpacingY        int     `json:"spacingY" yaml:"spacingY"`               // 水印垂直间距（96 DPI 下实际步长为该值的 4/3 倍像素）
+	FontPath        string  `json:"fontPath" yaml:"fontPath"`               // 自定义字体文件路径，留空使用内置字体
+	UseLayeredAlpha bool    `json:"useLayeredAlpha" yaml:"useLayeredAlpha"` // 是否使用逐像素 alpha 渲染
+	TextTemplate    string  `json:"textTemplate" yaml:"textTemplate"`       // 水印文字模板，%s 会被替换为当前用户名
+	Interpolation   string  `json:"interpolation" yaml:"interpolation"`     // 旋转裁剪时的采样方式："nearest" 或 "bilinear"
+}
+
+// Default 返回原先硬编码在 main.go 里的那组默认值，没有配置文件或解析失败时使用
+func Default() *Config {
+	return &Config{
+		Angle:           0.0,
+		ImageRotation:   320.0,
+		FontSize:        20.0,
+		SpaceCount:      5,
+		Alpha:           7,
+		SpacingX:        250,
+		SpacingY:        125,
+		UseLayeredAlpha: true,
+		TextTemplate:    "CompanyName %s",
+		Interpolation:   "bilinear",
+	}
+}
+
+// Load 从磁盘读取配置文件，根据扩展名选择 JSON 或 YAML 解析，
+// 未出现在文件中的字段保留 Default() 的值
+func Load(path string) (*Config, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	cfg := Default()
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		if err := yaml.Unmarshal(data, cfg); err != nil {
+			return nil, fmt.Errorf("解析 YAML 配置 %s 失败: %w", path, err)
+		}
+	default:
+		if err := json.Unmarshal(data, cfg); err != nil {
+			return nil, fmt.Errorf("解析 JSON 配置 %s 失败: %w", path, err)
+		}
+	}
+
+	cfg.sanitize()
+	return cfg, nil
+}
+
+// sanitize 修正会让渲染卡死或失效的非法字段：SpacingX/SpacingY 是
+// render.CreateWatermarkImage 平铺循环的步长，<=0 会让那两层 for 循环永远走不到
+// 终点；FontSize <=0 则画不出任何文字。手改配置文件或未来新增字段时都可能踩到，
+// 这里统一退回 Default() 的值而不是把判断散落到渲染代码里
+func (c *Config) sanitize() {
+	d := Default()
+	if c.SpacingX <= 0 {
+		log.Printf("config: spacingX=%d 非法，使用默认值 %d", c.SpacingX, d.SpacingX)
+		c.SpacingX = d.SpacingX
+	}
+	if c.SpacingY <= 0 {
+		log.Printf("config: spacingY=%d 非法，使用默认值 %d", c.SpacingY, d.SpacingY)
+		c.SpacingY = d.SpacingY
+	}
+	if c.FontSize <= 0 {
+		log.Printf("config: fontSize=%g 非法，使用默认值 %g", c.FontSize, d.FontSize)
+		c.FontSize = d.FontSize
+	}
+}
+
+// Watch 监听 path 所在目录，每当该文件被写入或（重新）创建时重新加载并回调 onChange。
+// 监听目录而不是文件本身是因为很多编辑器保存时会先删除再创建文件，直接监听文件会错过事件。
+func Watch(path string, onChange func(*Config)) (*fsnotify.Watcher, error) {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return nil, err
+	}
+
+	dir := filepath.Dir(path)
+	if err := watcher.Add(dir); err != nil {
+		watcher.Close()
+		return nil, err
+	}
+
+	target := filepath.Clean(path)
+
+	go func() {
+		for {
+			select {
+			case event, ok := <-watcher.Events:
+				if !ok {
+					return
+				}
+				if filepath.Clean(event.Name) != target {
+					continue
+				}
+				if event.Op&(fsnotify.Write|fsnotify.Create) == 0 {
+					continue
+				}
+
+				cfg, err := Load(path)
+				if err != nil {
+					log.Printf("config: 重新加载 %s 失败: %v", path, err)
+					continue
+				}
+				onChange(cfg)
+
+			case err, ok := <-watcher.Errors:
+				if !ok {
+					return
+				}
+				log.Printf("config: 监听 %s 出错: %v", dir, err)
+			}
+		}
+	}()
+
+	return watcher, nil
+}
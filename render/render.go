@@ -0,0 +1,248 @@
+// Package render 生成水印位图：把配置好的文字按角度和间距平铺绘制，
+// 再整体旋转裁剪到目标尺寸。不涉及任何 Windows API，方便独立测试。
+package render
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"math"
+	"os"
+	"runtime"
+	"strings"
+	"sync"
+
+	"github.com/golang/freetype"
+	"github.com/golang/freetype/truetype"
+	"golang.org/x/image/font/gofont/goregular"
+
+	"github.com/levywang/xwatermark/config"
+)
+
+// Options 描述一次水印渲染所需的、与配置无关的上下文信息
+type Options struct {
+	Width, Height int    // 目标位图尺寸（像素）
+	DPI           uint32 // 目标显示器的有效 DPI，用于换算字体大小和间距
+	Username      string // 当前登录用户名，会被过滤后填入文字模板
+}
+
+// 添加一个辅助函数来提取纯用户名
+func extractUsername(fullUsername string) string {
+	// 处理 domain\username 格式
+	if i := strings.LastIndex(fullUsername, "\\"); i >= 0 {
+		return fullUsername[i+1:]
+	}
+	// 处理 username@domain 格式
+	if i := strings.Index(fullUsername, "@"); i >= 0 {
+		return fullUsername[:i]
+	}
+	return fullUsername
+}
+
+func loadFont(cfg *config.Config) (*truetype.Font, error) {
+	if cfg.FontPath == "" {
+		return truetype.Parse(goregular.TTF)
+	}
+
+	data, err := os.ReadFile(cfg.FontPath)
+	if err != nil {
+		return nil, fmt.Errorf("读取字体文件 %s 失败: %w", cfg.FontPath, err)
+	}
+	return truetype.Parse(data)
+}
+
+// CreateWatermarkImage 按 cfg 描述的样式和 opts 描述的目标尺寸/DPI 生成水印位图
+func CreateWatermarkImage(cfg *config.Config, opts Options) (*image.RGBA, error) {
+	width, height := opts.Width, opts.Height
+
+	// 相对 96 DPI（100% 缩放）的换算比例，用于字体大小和间距的适配
+	dpiScale := float64(opts.DPI) / 96.0
+
+	// 减小画布尺寸，使用对角线的1.25倍而不是2倍
+	canvasSize := int(math.Sqrt(float64(width*width+height*height))) * 5 / 4
+	img := image.NewRGBA(image.Rect(0, 0, canvasSize, canvasSize))
+
+	// 使用更小的缓冲区绘制
+	bounds := img.Bounds()
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			img.Set(x, y, image.Transparent)
+		}
+	}
+
+	// 加载字体
+	font, err := loadFont(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	c := freetype.NewContext()
+	c.SetDPI(72)
+	c.SetFont(font)
+	c.SetFontSize(cfg.FontSize * dpiScale)
+	c.SetClip(img.Bounds())
+	c.SetDst(img)
+	c.SetSrc(image.Black)
+
+	// 获取水印文字
+	spaces := strings.Repeat(" ", cfg.SpaceCount)
+	template := cfg.TextTemplate
+	if template == "" {
+		template = "CompanyName %s"
+	}
+	watermarkText := fmt.Sprintf(template, extractUsername(opts.Username)) + spaces
+
+	// 计算水印间距（同样按显示器 DPI 缩放，保证不同屏幕上的疏密观感一致）
+	spacingX := int(float64(cfg.SpacingX) * 4 / 3 * dpiScale)
+	spacingY := int(float64(cfg.SpacingY) * 4 / 3 * dpiScale)
+
+	// 使用倾斜角度
+	angle := cfg.Angle * math.Pi / 180.0
+
+	// 优化绘制范围
+	startX := -canvasSize / 2
+	endX := canvasSize * 3 / 2
+	startY := -canvasSize / 2
+	endY := canvasSize * 3 / 2
+
+	// 批量绘制水印
+	for y := startY; y < endY; y += spacingY {
+		for x := startX; x < endX; x += spacingX {
+			rotX := float64(x)*math.Cos(angle) - float64(y)*math.Sin(angle)
+			rotY := float64(x)*math.Sin(angle) + float64(y)*math.Cos(angle)
+			rotX += float64(canvasSize) / 2
+			rotY += float64(canvasSize) / 2
+
+			if rotX >= 0 && rotX < float64(canvasSize) && rotY >= 0 && rotY < float64(canvasSize) {
+				pt := freetype.Pt(int(rotX), int(rotY))
+				c.DrawString(watermarkText, pt)
+			}
+		}
+	}
+
+	// 优化旋转和裁剪
+	final := RotateAndCrop(img, cfg.ImageRotation, width, height, cfg.Interpolation)
+	runtime.GC() // 手动触发垃圾回收
+	return final, nil
+}
+
+// RotateAndCrop 是优化的旋转和裁剪函数。interpolation 为 "nearest" 时保持原来的
+// 最近邻采样，其余情况（包括留空）使用双线性插值以消除旋转后文字边缘的锯齿。
+// 每一行的计算互不依赖，按 CPU 核数拆成多个 worker 并行处理。
+func RotateAndCrop(img *image.RGBA, angle float64, targetWidth, targetHeight int, interpolation string) *image.RGBA {
+	rad := angle * math.Pi / 180.0
+	bounds := img.Bounds()
+	w, h := float64(bounds.Dx()), float64(bounds.Dy())
+
+	// 直接创建目标大小的图像
+	dst := image.NewRGBA(image.Rect(0, 0, targetWidth, targetHeight))
+
+	// 计算中心点
+	cx, cy := w/2, h/2
+	newCX, newCY := float64(targetWidth)/2, float64(targetHeight)/2
+	sinR, cosR := math.Sin(-rad), math.Cos(-rad)
+
+	nearest := interpolation == "nearest"
+
+	workers := runtime.NumCPU()
+	if workers > targetHeight {
+		workers = targetHeight
+	}
+	if workers < 1 {
+		workers = 1
+	}
+	rowsPerWorker := (targetHeight + workers - 1) / workers
+
+	var wg sync.WaitGroup
+	for worker := 0; worker < workers; worker++ {
+		startY := worker * rowsPerWorker
+		endY := startY + rowsPerWorker
+		if endY > targetHeight {
+			endY = targetHeight
+		}
+		if startY >= endY {
+			continue
+		}
+
+		wg.Add(1)
+		go func(startY, endY int) {
+			defer wg.Done()
+
+			// 只处理目标区域的像素
+			for y := startY; y < endY; y++ {
+				dy := float64(y) - newCY
+				for x := 0; x < targetWidth; x++ {
+					// 反向计算源图像坐标
+					dx := float64(x) - newCX
+
+					oldX := dx*cosR - dy*sinR + cx
+					oldY := dx*sinR + dy*cosR + cy
+
+					if oldX < 0 || oldX >= w || oldY < 0 || oldY >= h {
+						continue
+					}
+
+					if nearest {
+						dst.Set(x, y, img.At(int(oldX), int(oldY)))
+						continue
+					}
+
+					if c, ok := bilinearSample(img, oldX, oldY, w, h); ok {
+						dst.SetRGBA(x, y, c)
+					}
+				}
+			}
+		}(startY, endY)
+	}
+	wg.Wait()
+
+	return dst
+}
+
+// bilinearSample 对源图像在 (oldX, oldY) 处做双线性插值采样：取四个相邻像素
+// p00/p10/p01/p11，按小数部分 fx/fy 加权混合 R/G/B/A 四个通道。
+// 四个采样点全部透明时返回 ok=false，避免把透明区域的噪声混进水印边缘。
+func bilinearSample(img *image.RGBA, oldX, oldY, maxW, maxH float64) (color.RGBA, bool) {
+	x0 := int(math.Floor(oldX))
+	y0 := int(math.Floor(oldY))
+
+	maxXIdx := int(maxW) - 1
+	maxYIdx := int(maxH) - 1
+
+	clamp := func(v, max int) int {
+		if v < 0 {
+			return 0
+		}
+		if v > max {
+			return max
+		}
+		return v
+	}
+
+	x0c, x1c := clamp(x0, maxXIdx), clamp(x0+1, maxXIdx)
+	y0c, y1c := clamp(y0, maxYIdx), clamp(y0+1, maxYIdx)
+
+	p00 := img.RGBAAt(x0c, y0c)
+	p10 := img.RGBAAt(x1c, y0c)
+	p01 := img.RGBAAt(x0c, y1c)
+	p11 := img.RGBAAt(x1c, y1c)
+
+	if p00.A == 0 && p10.A == 0 && p01.A == 0 && p11.A == 0 {
+		return color.RGBA{}, false
+	}
+
+	fx := oldX - float64(x0)
+	fy := oldY - float64(y0)
+
+	blend := func(c00, c10, c01, c11 uint8) uint8 {
+		v := (1-fx)*(1-fy)*float64(c00) + fx*(1-fy)*float64(c10) + (1-fx)*fy*float64(c01) + fx*fy*float64(c11)
+		return uint8(v + 0.5)
+	}
+
+	return color.RGBA{
+		R: blend(p00.R, p10.R, p01.R, p11.R),
+		G: blend(p00.G, p10.G, p01.G, p11.G),
+		B: blend(p00.B, p10.B, p01.B, p11.B),
+		A: blend(p00.A, p10.A, p01.A, p11.A),
+	}, true
+}
@@ -0,0 +1,73 @@
+package render
+
+import (
+	"image"
+	"image/color"
+	"testing"
+)
+
+func TestBilinearSampleClampsOutOfBoundsCoordinates(t *testing.T) {
+	img := image.NewRGBA(image.Rect(0, 0, 2, 2))
+	img.SetRGBA(0, 0, color.RGBA{R: 10, G: 20, B: 30, A: 255})
+	img.SetRGBA(1, 0, color.RGBA{R: 110, G: 120, B: 130, A: 255})
+	img.SetRGBA(0, 1, color.RGBA{R: 10, G: 20, B: 30, A: 255})
+	img.SetRGBA(1, 1, color.RGBA{R: 110, G: 120, B: 130, A: 255})
+
+	// 超出边界的坐标应该 clamp 到最近的那个角，而不是越界读取
+	c, ok := bilinearSample(img, -5, -5, 2, 2)
+	if !ok {
+		t.Fatal("expected ok=true for fully opaque source pixels")
+	}
+	if c.R != 10 || c.G != 20 || c.B != 30 {
+		t.Fatalf("expected clamp to (0,0) pixel, got %+v", c)
+	}
+}
+
+func TestBilinearSampleSymmetricBlendWeights(t *testing.T) {
+	img := image.NewRGBA(image.Rect(0, 0, 2, 1))
+	img.SetRGBA(0, 0, color.RGBA{R: 0, G: 0, B: 0, A: 255})
+	img.SetRGBA(1, 0, color.RGBA{R: 100, G: 100, B: 100, A: 255})
+
+	c, ok := bilinearSample(img, 0.5, 0, 2, 1)
+	if !ok {
+		t.Fatal("expected ok=true")
+	}
+	if c.R != 50 || c.G != 50 || c.B != 50 {
+		t.Fatalf("expected midpoint to blend 50/50, got %+v", c)
+	}
+}
+
+func TestBilinearSampleAllCornersTransparent(t *testing.T) {
+	img := image.NewRGBA(image.Rect(0, 0, 2, 2))
+
+	// 四个采样点都是完全透明时不应该产生任何颜色噪声
+	_, ok := bilinearSample(img, 0.5, 0.5, 2, 2)
+	if ok {
+		t.Fatal("expected ok=false when all four corners are fully transparent")
+	}
+}
+
+func TestRotateAndCropNearestVsBilinearAgreeOnIdentity(t *testing.T) {
+	src := image.NewRGBA(image.Rect(0, 0, 4, 4))
+	for y := 0; y < 4; y++ {
+		for x := 0; x < 4; x++ {
+			src.SetRGBA(x, y, color.RGBA{R: uint8(x * 50), G: uint8(y * 50), B: 0, A: 255})
+		}
+	}
+
+	// 零度旋转、源尺寸和目标尺寸相同时，两种采样方式都应该精确复原原图
+	nearest := RotateAndCrop(src, 0, 4, 4, "nearest")
+	bilinear := RotateAndCrop(src, 0, 4, 4, "bilinear")
+
+	for y := 0; y < 4; y++ {
+		for x := 0; x < 4; x++ {
+			want := src.RGBAAt(x, y)
+			if got := nearest.RGBAAt(x, y); got != want {
+				t.Fatalf("nearest[%d,%d] = %+v, want %+v", x, y, got, want)
+			}
+			if got := bilinear.RGBAAt(x, y); got != want {
+				t.Fatalf("bilinear[%d,%d] = %+v, want %+v", x, y, got, want)
+			}
+		}
+	}
+}
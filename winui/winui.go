@@ -0,0 +1,872 @@
+// Package winui 负责所有 Win32 层面的事情：按显示器创建透明置顶窗口、
+// 把 render 包生成的位图推送到屏幕，以及托盘图标和右键菜单。
+package winui
+
+import (
+	"image"
+	"log"
+	"sync"
+	"syscall"
+	"time"
+	"unsafe"
+
+	"github.com/levywang/xwatermark/config"
+	"github.com/levywang/xwatermark/render"
+)
+
+var (
+	// Windows API DLL 和函数
+	user32                         = syscall.NewLazyDLL("user32.dll")             // user32.dll 动态链接库
+	procCreateWindowEx             = user32.NewProc("CreateWindowExW")            // 创建窗口
+	procDefWindowProc              = user32.NewProc("DefWindowProcW")             // 默认窗口过程
+	procDispatchMessage            = user32.NewProc("DispatchMessageW")           // 分发消息
+	procGetMessage                 = user32.NewProc("GetMessageW")                // 获取消息
+	procRegisterClassEx            = user32.NewProc("RegisterClassExW")           // 注册窗口类
+	procShowWindow                 = user32.NewProc("ShowWindow")                 // 显示窗口
+	procUpdateWindow               = user32.NewProc("UpdateWindow")               // 更新窗口
+	procGetSystemMetrics           = user32.NewProc("GetSystemMetrics")           // 获取系统指标
+	procSetLayeredWindowAttributes = user32.NewProc("SetLayeredWindowAttributes") // 设置分层窗口属性
+	procUpdateLayeredWindow        = user32.NewProc("UpdateLayeredWindow")        // 更新分层窗口（逐像素 alpha）
+	procGetDC                      = user32.NewProc("GetDC")                      // 获取设备上下文
+	procReleaseDC                  = user32.NewProc("ReleaseDC")                  // 释放设备上下文
+	procEnumDisplayMonitors        = user32.NewProc("EnumDisplayMonitors")        // 枚举显示器
+	procGetMonitorInfoW            = user32.NewProc("GetMonitorInfoW")            // 获取显示器信息
+	procSetProcessDpiAwarenessCtx  = user32.NewProc("SetProcessDpiAwarenessContext") // 设置进程 DPI 感知级别
+	procInvalidateRect             = user32.NewProc("InvalidateRect")             // 使窗口区域失效，触发重绘
+	procCreatePopupMenu            = user32.NewProc("CreatePopupMenu")            // 创建弹出菜单
+	procAppendMenuW                = user32.NewProc("AppendMenuW")                // 添加菜单项
+	procTrackPopupMenu             = user32.NewProc("TrackPopupMenu")             // 弹出右键菜单
+	procSetForegroundWindow        = user32.NewProc("SetForegroundWindow")        // 菜单正常关闭所需
+	procGetCursorPos               = user32.NewProc("GetCursorPos")               // 获取鼠标位置
+	procPostQuitMessage            = user32.NewProc("PostQuitMessage")            // 投递退出消息
+	procDestroyMenu                = user32.NewProc("DestroyMenu")                // 销毁菜单
+	procSetWindowPos               = user32.NewProc("SetWindowPos")               // 调整窗口位置/尺寸/Z序
+	procGetForegroundWindow        = user32.NewProc("GetForegroundWindow")        // 获取前台窗口
+	procSetWindowsHookExW          = user32.NewProc("SetWindowsHookExW")          // 安装全局钩子
+	procCallNextHookEx             = user32.NewProc("CallNextHookEx")             // 把钩子事件传给下一个钩子
+	procUnhookWindowsHookEx        = user32.NewProc("UnhookWindowsHookEx")        // 卸载钩子
+	procIsWindowVisible            = user32.NewProc("IsWindowVisible")            // 查询窗口是否可见
+	procDestroyWindow              = user32.NewProc("DestroyWindow")              // 销毁窗口
+
+	// shcore.dll：按显示器查询 DPI
+	shcore32             = syscall.NewLazyDLL("shcore.dll")
+	procGetDpiForMonitor = shcore32.NewProc("GetDpiForMonitor")
+
+	// shell32.dll：托盘图标
+	shell32            = syscall.NewLazyDLL("shell32.dll")
+	procShellNotifyIcon = shell32.NewProc("Shell_NotifyIconW")
+
+	// kernel32.dll：键盘钩子需要一个当前模块的句柄
+	kernel32             = syscall.NewLazyDLL("kernel32.dll")
+	procGetModuleHandleW = kernel32.NewProc("GetModuleHandleW")
+
+	// GDI 相关函数
+	gdi32                  = syscall.NewLazyDLL("gdi32.dll")     // gdi32.dll 动态链接库
+	procCreateCompatibleDC = gdi32.NewProc("CreateCompatibleDC") // 创建兼容设备上下文
+	procDeleteDC           = gdi32.NewProc("DeleteDC")           // 删除设备上下文
+	procSelectObject       = gdi32.NewProc("SelectObject")       // 选择对象
+	procDeleteObject       = gdi32.NewProc("DeleteObject")       // 删除对象
+	procCreateDIBSection   = gdi32.NewProc("CreateDIBSection")   // 创建 DIB 位图
+
+	// msimg32.dll：非分层窗口也需要按逐像素 alpha 混合水印，BitBlt 不读 alpha 通道
+	msimg32        = syscall.NewLazyDLL("msimg32.dll")
+	procAlphaBlend = msimg32.NewProc("AlphaBlend")
+)
+
+const (
+	wsExLayered     = 0x00080000
+	wsExTopmost     = 0x00000008
+	wsExTransparent = 0x00000020 // 点击穿透
+	wsExToolWindow  = 0x00000080 // 不在任务栏显示
+	wsPopup         = 0x80000000
+
+	lwaAlpha = 0x00000002
+
+	smCxScreen = 0
+	smCyScreen = 1
+
+	wmNchittest     = 0x0084
+	wmPaint         = 0x000F
+	wmDestroy       = 0x0002
+	wmCommand       = 0x0111
+	wmRbuttonUp     = 0x0205
+	wmTrayNotify    = 0x8000 // WM_APP 基准上的自定义托盘消息
+	wmDisplaychange = 0x007E // 分辨率/显示器数量变化
+	wmDpichanged    = 0x02E0 // 窗口被系统移动到不同 DPI 的显示器
+	wmSettingchange = 0x001A // 系统级设置变化（含显示设置）
+	htTransparent   = ^uintptr(0)
+
+	swpNoSize     = 0x0001
+	swpNoMove     = 0x0002
+	swpNoZorder   = 0x0004
+	swpNoActivate = 0x0010
+	hwndTopmost   = ^uintptr(0) // -1，SetWindowPos 的 HWND_TOPMOST
+
+	// WH_KEYBOARD_LL 低级键盘钩子：拦截 Alt+F4 等试图关闭前台窗口的快捷键
+	whKeyboardLl = 13
+	wmSyskeydown = 0x0104
+	vkF4         = 0x73
+
+	ulwAlpha   = 0x00000002
+	acSrcOver  = 0x00
+	acSrcAlpha = 0x01
+
+	mdtEffectiveDPI = 0
+
+	// 让进程按显示器分别感知 DPI，系统不再对我们的窗口做位图拉伸
+	dpiAwarenessContextPerMonitorAwareV2 = ^uintptr(3) // -4
+
+	nifMessage = 0x00000001
+	nifIcon    = 0x00000002
+	nifTip     = 0x00000004
+	nimAdd     = 0x00000000
+	nimDelete  = 0x00000002
+
+	mfString = 0x00000000
+	tpmRightButton = 0x0002
+	tpmReturnCmd   = 0x0100
+
+	idMenuReload        = 1
+	idMenuToggleVisible = 2
+	idMenuExit          = 3
+)
+
+type (
+	hicon  uintptr
+	hcursor uintptr
+	hbrush uintptr
+	hmenu  uintptr
+)
+
+type rect struct {
+	Left, Top, Right, Bottom int32
+}
+
+type point struct {
+	X, Y int32
+}
+
+type msg struct {
+	Hwnd    uintptr
+	Message uint32
+	WParam  uintptr
+	LParam  uintptr
+	Time    uint32
+	Pt      point
+}
+
+type wndClassEx struct {
+	CbSize     uint32
+	Style      uint32
+	WndProc    uintptr
+	ClsExtra   int32
+	WndExtra   int32
+	Instance   uintptr
+	Icon       hicon
+	Cursor     hcursor
+	Background hbrush
+	MenuName   *uint16
+	ClassName  *uint16
+	IconSm     hicon
+}
+
+type paintStruct struct {
+	Hdc         uintptr
+	FErase      int32
+	RcPaint     rect
+	FRestore    int32
+	FIncUpdate  int32
+	RgbReserved [32]byte
+}
+
+// bitmapInfoHeader 对应 Win32 的 BITMAPINFOHEADER，用于 CreateDIBSection。
+// 32 位 BGRA、biHeight 取负数表示自顶向下的行序，这样像素缓冲区的内存布局
+// 与 image.RGBA 的行顺序一致，逐行复制时无需翻转。
+type bitmapInfoHeader struct {
+	BiSize          uint32
+	BiWidth         int32
+	BiHeight        int32
+	BiPlanes        uint16
+	BiBitCount      uint16
+	BiCompression   uint32
+	BiSizeImage     uint32
+	BiXPelsPerMeter int32
+	BiYPelsPerMeter int32
+	BiClrUsed       uint32
+	BiClrImportant  uint32
+}
+
+type blendFunction struct {
+	BlendOp             byte
+	BlendFlags          byte
+	SourceConstantAlpha byte
+	AlphaFormat         byte
+}
+
+// perPixelAlphaBlend：整窗透明度固定拉满，由逐像素预乘 alpha 决定每个点的透明度
+var perPixelAlphaBlend = blendFunction{BlendOp: acSrcOver, SourceConstantAlpha: 255, AlphaFormat: acSrcAlpha}
+
+// packBlendFunction 把 4 字节的 BLENDFUNCTION 打包成一个 uintptr。
+// AlphaBlend（不同于按指针接收 BLENDFUNCTION 的 UpdateLayeredWindow）按值接收该结构体，
+// 而它在 x64 调用约定下等价于一个 DWORD，直接塞进一个参数寄存器即可。
+func packBlendFunction(bf blendFunction) uintptr {
+	return uintptr(*(*uint32)(unsafe.Pointer(&bf)))
+}
+
+type size struct {
+	Cx, Cy int32
+}
+
+// notifyIconData 对应精简后的 NOTIFYICONDATAW（够用即可，不需要 GUID/状态等新字段）
+type notifyIconData struct {
+	CbSize           uint32
+	Hwnd             uintptr
+	UID              uint32
+	UFlags           uint32
+	UCallbackMessage uint32
+	HIcon            uintptr
+	SzTip            [128]uint16
+}
+
+// MonitorInfo 是枚举显示器后保留的精简信息：虚拟桌面坐标系下的边界矩形
+// （多屏时左上角可以是负数），以及该显示器的有效 DPI
+type MonitorInfo struct {
+	Rect rect
+	DPI  uint32
+}
+
+type monitorWindowInfo struct {
+	CbSize    uint32
+	RcMonitor rect
+	RcWork    rect
+	Flags     uint32
+}
+
+// kbdllhookstruct 对应 WH_KEYBOARD_LL 回调收到的 KBDLLHOOKSTRUCT
+type kbdllhookstruct struct {
+	VkCode      uint32
+	ScanCode    uint32
+	Flags       uint32
+	Time        uint32
+	DwExtraInfo uintptr
+}
+
+// enumerateMonitors 通过 EnumDisplayMonitors 枚举所有显示器，并用
+// GetDpiForMonitor 查询各自的 DPI，供每个水印窗口按所在显示器独立缩放
+func enumerateMonitors() []MonitorInfo {
+	var result []MonitorInfo
+
+	cb := syscall.NewCallback(func(hMonitor, _ uintptr, _ *rect, _ uintptr) uintptr {
+		var mi monitorWindowInfo
+		mi.CbSize = uint32(unsafe.Sizeof(mi))
+		procGetMonitorInfoW.Call(hMonitor, uintptr(unsafe.Pointer(&mi)))
+
+		var dpiX, dpiY uint32
+		procGetDpiForMonitor.Call(
+			hMonitor,
+			mdtEffectiveDPI,
+			uintptr(unsafe.Pointer(&dpiX)),
+			uintptr(unsafe.Pointer(&dpiY)),
+		)
+		if dpiX == 0 {
+			dpiX = 96 // 查询失败时退化为 100% 缩放
+		}
+
+		result = append(result, MonitorInfo{Rect: mi.RcMonitor, DPI: dpiX})
+		return 1 // 返回非 0 继续枚举下一个显示器
+	})
+
+	procEnumDisplayMonitors.Call(0, 0, cb, 0)
+	return result
+}
+
+// monitorWindow 持有单个显示器对应的水印窗口状态：该显示器的水印图片，
+// 以及只在窗口尺寸变化时才重建的离屏 DIB 缓冲区
+type monitorWindow struct {
+	hwnd uintptr
+
+	// mu 保护下面这组渲染状态：WM_PAINT 在窗口消息线程上读取/写入它们，
+	// 而 rebuildWindow 既可能从同一线程调用，也可能从 config.Watch 的
+	// fsnotify 后台 goroutine 或 handleDisplayChange 调用，没有这把锁
+	// 会在配置热重载时与正在进行的重绘竞争同一组 GDI 句柄
+	mu  sync.Mutex
+	mon MonitorInfo
+
+	image *image.RGBA
+
+	backDC     uintptr
+	backBitmap uintptr
+	backOld    uintptr
+	backBits   unsafe.Pointer
+	backWidth  int
+	backHeight int
+}
+
+// App 是整个水印覆盖层的运行时状态：当前配置、每个显示器的窗口，以及托盘图标
+type App struct {
+	username string
+
+	mu      sync.Mutex
+	cfg     *config.Config
+	windows map[uintptr]*monitorWindow
+	visible bool
+
+	trayHwnd uintptr
+
+	className  *uint16
+	windowName *uint16
+
+	keyboardHook uintptr
+	stopWatchdog chan struct{}
+
+	remainingWindows int // 还存活的顶层窗口数（水印窗口 + 托盘控制窗口），归零时退出消息循环
+}
+
+// NewApp 创建一个尚未显示任何窗口的 App，真正的窗口在 Run 中创建
+func NewApp(cfg *config.Config, username string) *App {
+	return &App{
+		username: username,
+		cfg:      cfg,
+		windows:  make(map[uintptr]*monitorWindow),
+		visible:  true,
+	}
+}
+
+func ensureBackBuffer(mw *monitorWindow, hdc uintptr, width, height int) unsafe.Pointer {
+	if mw.backDC != 0 && mw.backWidth == width && mw.backHeight == height {
+		return mw.backBits
+	}
+
+	if mw.backBitmap != 0 {
+		procSelectObject.Call(mw.backDC, mw.backOld)
+		procDeleteObject.Call(mw.backBitmap)
+		mw.backBitmap = 0
+	}
+	if mw.backDC != 0 {
+		procDeleteDC.Call(mw.backDC)
+		mw.backDC = 0
+	}
+
+	memDC, _, _ := procCreateCompatibleDC.Call(hdc)
+	if memDC == 0 {
+		return nil
+	}
+
+	bi := bitmapInfoHeader{
+		BiSize:        uint32(unsafe.Sizeof(bitmapInfoHeader{})),
+		BiWidth:       int32(width),
+		BiHeight:      -int32(height),
+		BiPlanes:      1,
+		BiBitCount:    32,
+		BiCompression: 0, // BI_RGB
+	}
+
+	var bits unsafe.Pointer
+	bitmap, _, _ := procCreateDIBSection.Call(
+		hdc,
+		uintptr(unsafe.Pointer(&bi)),
+		0, // DIB_RGB_COLORS
+		uintptr(unsafe.Pointer(&bits)),
+		0, 0,
+	)
+	if bitmap == 0 {
+		procDeleteDC.Call(memDC)
+		return nil
+	}
+
+	oldBitmap, _, _ := procSelectObject.Call(memDC, bitmap)
+
+	mw.backDC = memDC
+	mw.backBitmap = bitmap
+	mw.backOld = oldBitmap
+	mw.backBits = bits
+	mw.backWidth = width
+	mw.backHeight = height
+
+	return mw.backBits
+}
+
+// writeWatermarkToDIB 将 mw.image 按像素复制进 DIB 缓冲区
+// （RGBA -> BGRA，并按配置的 alpha 预乘）
+func writeWatermarkToDIB(mw *monitorWindow, bits unsafe.Pointer, width, height int, alpha uint32) {
+	dst := unsafe.Slice((*byte)(bits), width*height*4)
+	img := mw.image
+
+	for y := 0; y < height; y++ {
+		row := y * width * 4
+		for x := 0; x < width; x++ {
+			r, g, b, a := img.At(x, y).RGBA()
+			// image.RGBA 的 At 返回的是已经按像素自身覆盖率预乘过的 16 位分量
+			// （还原到 8 位即 B0*A0/255 等），这里只需要再乘以配置的整体 alpha 把它们
+			// 按比例调暗；如果像 a8 那样再乘一遍 A0 就是把覆盖率算了两次，颜色会偏暗
+			a8 := uint32(a>>8) * alpha / 255
+			off := row + x*4
+			dst[off+0] = byte(uint32(b>>8) * alpha / 255) // B
+			dst[off+1] = byte(uint32(g>>8) * alpha / 255) // G
+			dst[off+2] = byte(uint32(r>>8) * alpha / 255) // R
+			dst[off+3] = byte(a8)                         // A
+		}
+	}
+}
+
+// pushLayeredWatermark 将 mw 的水印图片通过 UpdateLayeredWindow 推送到其窗口，
+// 使用预乘 BGRA + AC_SRC_ALPHA，逐像素 alpha 得以保留
+func pushLayeredWatermark(mw *monitorWindow, alpha uint32) {
+	width := int(mw.mon.Rect.Right - mw.mon.Rect.Left)
+	height := int(mw.mon.Rect.Bottom - mw.mon.Rect.Top)
+
+	screenDC, _, _ := procGetDC.Call(0)
+	if screenDC == 0 {
+		return
+	}
+	defer procReleaseDC.Call(0, screenDC)
+
+	bits := ensureBackBuffer(mw, screenDC, width, height)
+	if bits == nil {
+		return
+	}
+	writeWatermarkToDIB(mw, bits, width, height, alpha)
+
+	sz := size{Cx: int32(width), Cy: int32(height)}
+	srcPt := point{X: 0, Y: 0}
+	blend := blendFunction{
+		BlendOp:             acSrcOver,
+		BlendFlags:          0,
+		SourceConstantAlpha: 255, // 透明度完全由逐像素预乘 alpha 决定
+		AlphaFormat:         acSrcAlpha,
+	}
+
+	procUpdateLayeredWindow.Call(
+		mw.hwnd,
+		0, // hdcDst：沿用当前窗口位置，不改变
+		0, // pptDst：不移动窗口
+		uintptr(unsafe.Pointer(&sz)),
+		mw.backDC,
+		uintptr(unsafe.Pointer(&srcPt)),
+		0, // crKey：不使用色键
+		uintptr(unsafe.Pointer(&blend)),
+		ulwAlpha,
+	)
+}
+
+// rebuildWindow 用当前配置重新生成 mw 的水印图片，并按渲染模式推送/重绘
+func (a *App) rebuildWindow(mw *monitorWindow, cfg *config.Config) {
+	mw.mu.Lock()
+	defer mw.mu.Unlock()
+
+	width := int(mw.mon.Rect.Right - mw.mon.Rect.Left)
+	height := int(mw.mon.Rect.Bottom - mw.mon.Rect.Top)
+
+	img, err := render.CreateWatermarkImage(cfg, render.Options{
+		Width:    width,
+		Height:   height,
+		DPI:      mw.mon.DPI,
+		Username: a.username,
+	})
+	if err != nil {
+		log.Printf("winui: 重新生成水印失败: %v", err)
+		return
+	}
+	mw.image = img
+
+	if cfg.UseLayeredAlpha {
+		pushLayeredWatermark(mw, cfg.Alpha)
+	} else {
+		procSetLayeredWindowAttributes.Call(mw.hwnd, 0, uintptr(cfg.Alpha), lwaAlpha)
+		procInvalidateRect.Call(mw.hwnd, 0, 1)
+	}
+}
+
+// Reload 在配置文件变化时被调用：替换当前配置并重新生成所有窗口的水印
+func (a *App) Reload(cfg *config.Config) {
+	a.mu.Lock()
+	a.cfg = cfg
+	windows := make([]*monitorWindow, 0, len(a.windows))
+	for _, mw := range a.windows {
+		windows = append(windows, mw)
+	}
+	a.mu.Unlock()
+
+	log.Printf("winui: 配置已重新加载，重建 %d 个水印窗口", len(windows))
+	for _, mw := range windows {
+		a.rebuildWindow(mw, cfg)
+	}
+}
+
+func (a *App) toggleVisibility() {
+	a.mu.Lock()
+	a.visible = !a.visible
+	visible := a.visible
+	windows := make([]*monitorWindow, 0, len(a.windows))
+	for _, mw := range a.windows {
+		windows = append(windows, mw)
+	}
+	a.mu.Unlock()
+
+	showCmd := uintptr(1) // SW_SHOWNORMAL
+	if !visible {
+		showCmd = 0 // SW_HIDE
+	}
+	for _, mw := range windows {
+		procShowWindow.Call(mw.hwnd, showCmd)
+	}
+}
+
+func (a *App) showTrayMenu(hwnd uintptr) {
+	menu, _, _ := procCreatePopupMenu.Call()
+	if menu == 0 {
+		return
+	}
+	defer procDestroyMenu.Call(menu)
+
+	procAppendMenuW.Call(menu, mfString, idMenuReload, uintptr(unsafe.Pointer(syscall.StringToUTF16Ptr("重新加载配置"))))
+	procAppendMenuW.Call(menu, mfString, idMenuToggleVisible, uintptr(unsafe.Pointer(syscall.StringToUTF16Ptr("显示/隐藏水印"))))
+	procAppendMenuW.Call(menu, mfString, idMenuExit, uintptr(unsafe.Pointer(syscall.StringToUTF16Ptr("退出"))))
+
+	var cursor point
+	procGetCursorPos.Call(uintptr(unsafe.Pointer(&cursor)))
+
+	// 菜单需要前台窗口才能正常响应点击外部自动关闭
+	procSetForegroundWindow.Call(hwnd)
+	procTrackPopupMenu.Call(
+		menu,
+		tpmRightButton, // 不带 TPM_RETURNCMD：选中的菜单项以 WM_COMMAND 发给 hwnd，由 wndProc 交给 handleTrayCommand
+		uintptr(cursor.X),
+		uintptr(cursor.Y),
+		0,
+		hwnd,
+		0,
+	)
+}
+
+func (a *App) handleTrayCommand(id uintptr) {
+	switch id {
+	case idMenuReload:
+		a.mu.Lock()
+		cfg := a.cfg
+		a.mu.Unlock()
+		a.Reload(cfg)
+	case idMenuToggleVisible:
+		a.toggleVisibility()
+	case idMenuExit:
+		procPostQuitMessage.Call(0)
+	}
+}
+
+// createMonitorWindow 为 mon 创建一个透明置顶的水印窗口并立即用 cfg 渲染一次，
+// 启动时的窗口创建循环和显示设置变化后的重建都走这里
+func (a *App) createMonitorWindow(mon MonitorInfo, cfg *config.Config) *monitorWindow {
+	width := int(mon.Rect.Right - mon.Rect.Left)
+	height := int(mon.Rect.Bottom - mon.Rect.Top)
+
+	mw := &monitorWindow{mon: mon}
+
+	hwnd, _, _ := procCreateWindowEx.Call(
+		wsExLayered|wsExTopmost|wsExTransparent|wsExToolWindow,
+		uintptr(unsafe.Pointer(a.className)),
+		uintptr(unsafe.Pointer(a.windowName)),
+		wsPopup,
+		uintptr(int(mon.Rect.Left)),
+		uintptr(int(mon.Rect.Top)),
+		uintptr(width),
+		uintptr(height),
+		0, 0, 0, 0,
+	)
+	if hwnd == 0 {
+		return nil
+	}
+	mw.hwnd = hwnd
+
+	a.mu.Lock()
+	a.windows[hwnd] = mw
+	a.remainingWindows++
+	a.mu.Unlock()
+
+	a.rebuildWindow(mw, cfg)
+
+	procShowWindow.Call(hwnd, 1)
+	procUpdateWindow.Call(hwnd)
+
+	return mw
+}
+
+// handleDisplayChange 在分辨率、显示器数量或 DPI 变化后重新枚举显示器：
+// 显示器数量不变时按新的矩形/DPI 原地调整并重绘现有窗口，数量变化时
+// 销毁所有旧窗口并按新列表重新创建，保证水印始终覆盖当前的整个虚拟桌面
+func (a *App) handleDisplayChange() {
+	monitors := enumerateMonitors()
+	if len(monitors) == 0 {
+		return
+	}
+
+	a.mu.Lock()
+	cfg := a.cfg
+	existing := make([]*monitorWindow, 0, len(a.windows))
+	for _, mw := range a.windows {
+		existing = append(existing, mw)
+	}
+	a.mu.Unlock()
+
+	if len(existing) == len(monitors) {
+		for i, mw := range existing {
+			mon := monitors[i]
+			mw.mu.Lock()
+			mw.mon = mon
+			mw.mu.Unlock()
+			width := int(mon.Rect.Right - mon.Rect.Left)
+			height := int(mon.Rect.Bottom - mon.Rect.Top)
+			procSetWindowPos.Call(mw.hwnd, 0,
+				uintptr(int(mon.Rect.Left)), uintptr(int(mon.Rect.Top)),
+				uintptr(width), uintptr(height),
+				swpNoZorder|swpNoActivate)
+			a.rebuildWindow(mw, cfg)
+		}
+		return
+	}
+
+	log.Printf("winui: 显示器数量变化 (%d -> %d)，重建所有水印窗口", len(existing), len(monitors))
+	a.mu.Lock()
+	a.windows = make(map[uintptr]*monitorWindow)
+	a.mu.Unlock()
+	for _, mw := range existing {
+		procDestroyWindow.Call(mw.hwnd)
+	}
+	for _, mon := range monitors {
+		a.createMonitorWindow(mon, cfg)
+	}
+}
+
+// topmostWatchdog 定期检查每个水印窗口是否仍然可见且置顶，
+// 防止其他同样请求置顶的程序把水印窗口压到下面
+func (a *App) topmostWatchdog() {
+	ticker := time.NewTicker(2 * time.Second)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-a.stopWatchdog:
+			return
+		case <-ticker.C:
+			a.mu.Lock()
+			windows := make([]*monitorWindow, 0, len(a.windows))
+			for _, mw := range a.windows {
+				windows = append(windows, mw)
+			}
+			a.mu.Unlock()
+
+			for _, mw := range windows {
+				visible, _, _ := procIsWindowVisible.Call(mw.hwnd)
+				if visible == 0 {
+					continue
+				}
+				procSetWindowPos.Call(mw.hwnd, hwndTopmost, 0, 0, 0, 0, swpNoSize|swpNoMove|swpNoActivate)
+			}
+		}
+	}
+}
+
+// isOurWindowForeground 判断当前前台窗口是否属于本程序。注意：水印窗口本身带有
+// WS_EX_TRANSPARENT|WS_EX_TOOLWINDOW，并在 WM_NCHITTEST 里总是返回 HTTRANSPARENT，
+// 结构上不可能通过正常的鼠标/Alt+Tab 交互成为前台窗口，所以这里实际只对托盘控制窗口
+// 有意义（例如右键菜单弹出期间 SetForegroundWindow 把它设为前台的那一小段时间）；
+// 对 a.windows 的检查只是以防将来水印窗口的窗口样式变得可以获得焦点
+func (a *App) isOurWindowForeground() bool {
+	fg, _, _ := procGetForegroundWindow.Call()
+	if fg == a.trayHwnd {
+		return true
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	_, ok := a.windows[fg]
+	return ok
+}
+
+// installKeyboardHook 安装一个低级键盘钩子，在本程序窗口是前台窗口时拦截 Alt+F4。
+// 受当前窗口样式限制（见 isOurWindowForeground 的注释），这目前只能保护托盘控制
+// 窗口不被关闭，对无法获得焦点的水印窗口本身没有实际防护作用
+func (a *App) installKeyboardHook() uintptr {
+	hMod, _, _ := procGetModuleHandleW.Call(0)
+
+	// lparam 直接声明为 *kbdllhookstruct，由 syscall.NewCallback 负责编组，
+	// 避免在函数体里把 uintptr 转回指针（这正是 enumerateMonitors 的回调
+	// 对 *rect 参数的处理方式，也是 go vet 不会对此报 "possible misuse of
+	// unsafe.Pointer" 的写法）
+	hookProc := func(nCode uintptr, wparam uintptr, lparam *kbdllhookstruct) uintptr {
+		if int32(nCode) >= 0 && wparam == wmSyskeydown {
+			if lparam.VkCode == vkF4 && a.isOurWindowForeground() {
+				return 1 // 非 0 表示吞掉这个按键，不再传给其他程序
+			}
+		}
+		ret, _, _ := procCallNextHookEx.Call(0, nCode, wparam, uintptr(unsafe.Pointer(lparam)))
+		return ret
+	}
+
+	hook, _, _ := procSetWindowsHookExW.Call(whKeyboardLl, syscall.NewCallback(hookProc), hMod, 0)
+	return hook
+}
+
+// Run 枚举显示器、创建每个显示器的水印窗口和托盘图标，然后进入消息循环阻塞直到退出
+func (a *App) Run() error {
+	procSetProcessDpiAwarenessCtx.Call(dpiAwarenessContextPerMonitorAwareV2)
+
+	monitors := enumerateMonitors()
+	if len(monitors) == 0 {
+		// 枚举失败时退化为主显示器，保证至少有一个水印窗口
+		w, _, _ := procGetSystemMetrics.Call(uintptr(smCxScreen))
+		h, _, _ := procGetSystemMetrics.Call(uintptr(smCyScreen))
+		monitors = []MonitorInfo{{Rect: rect{Left: 0, Top: 0, Right: int32(w), Bottom: int32(h)}, DPI: 96}}
+	}
+
+	a.remainingWindows = 0
+
+	wndProc := func(hwnd uintptr, message uint32, wparam, lparam uintptr) uintptr {
+		switch message {
+		case wmDestroy:
+			a.mu.Lock()
+			delete(a.windows, hwnd)
+			a.remainingWindows--
+			remaining := a.remainingWindows
+			a.mu.Unlock()
+			if remaining <= 0 {
+				procPostQuitMessage.Call(0)
+			}
+			return 0
+		case wmNchittest:
+			return htTransparent
+		case wmTrayNotify:
+			if lparam == wmRbuttonUp {
+				a.showTrayMenu(hwnd)
+			}
+			return 0
+		case wmCommand:
+			a.handleTrayCommand(wparam & 0xffff)
+			return 0
+		case wmDisplaychange, wmDpichanged, wmSettingchange:
+			a.handleDisplayChange()
+			return 0
+		case wmPaint:
+			a.mu.Lock()
+			mw := a.windows[hwnd]
+			cfg := a.cfg
+			a.mu.Unlock()
+
+			var ps paintStruct
+			hdc, _, _ := user32.NewProc("BeginPaint").Call(hwnd, uintptr(unsafe.Pointer(&ps)))
+			if hdc == 0 {
+				return 0
+			}
+			defer user32.NewProc("EndPaint").Call(hwnd, uintptr(unsafe.Pointer(&ps)))
+
+			if mw == nil || cfg.UseLayeredAlpha {
+				// 分层 alpha 模式下窗口内容完全由 UpdateLayeredWindow 推送，
+				// WM_PAINT 只需要 Begin/EndPaint 走一遍校验流程，不做任何绘制
+				return 0
+			}
+
+			// mw.mu 同时防止这里与 config.Watch 的热重载 goroutine、
+			// handleDisplayChange 并发改写同一组 DIB/DC 句柄
+			mw.mu.Lock()
+			defer mw.mu.Unlock()
+
+			width := int(mw.mon.Rect.Right - mw.mon.Rect.Left)
+			height := int(mw.mon.Rect.Bottom - mw.mon.Rect.Top)
+
+			bits := ensureBackBuffer(mw, hdc, width, height)
+			if bits == nil {
+				return 0
+			}
+			writeWatermarkToDIB(mw, bits, width, height, cfg.Alpha)
+
+			// writeWatermarkToDIB 写入的是预乘 BGRA，BitBlt 不读 alpha 通道会把整个
+			// 窗口糊成一块纯色；这里必须用 AlphaBlend + AC_SRC_ALPHA 按逐像素 alpha 混合
+			procAlphaBlend.Call(hdc, 0, 0, uintptr(width), uintptr(height),
+				mw.backDC, 0, 0, uintptr(width), uintptr(height), packBlendFunction(perPixelAlphaBlend))
+			return 0
+		default:
+			ret, _, _ := procDefWindowProc.Call(hwnd, uintptr(message), wparam, lparam)
+			return ret
+		}
+	}
+
+	className := syscall.StringToUTF16Ptr("WatermarkClass")
+	windowName := syscall.StringToUTF16Ptr("Watermark")
+	a.className = className
+	a.windowName = windowName
+
+	wndClass := wndClassEx{
+		CbSize:    uint32(unsafe.Sizeof(wndClassEx{})),
+		WndProc:   syscall.NewCallback(wndProc),
+		ClassName: className,
+	}
+
+	ret, _, err := procRegisterClassEx.Call(uintptr(unsafe.Pointer(&wndClass)))
+	if ret == 0 {
+		return err
+	}
+
+	a.mu.Lock()
+	cfg := a.cfg
+	a.mu.Unlock()
+
+	// 每个显示器一个水印窗口，位置/尺寸取自该显示器在虚拟桌面坐标系中的矩形，
+	// 字体和间距按该显示器的 DPI 单独缩放
+	for _, mon := range monitors {
+		a.createMonitorWindow(mon, cfg)
+	}
+
+	// 托盘图标挂在一个独立的隐藏控制窗口上，不与点击穿透的水印窗口混用
+	trayHwnd, _, _ := procCreateWindowEx.Call(
+		0,
+		uintptr(unsafe.Pointer(className)),
+		uintptr(unsafe.Pointer(windowName)),
+		0, // 不使用 WS_POPUP，也不显示
+		0, 0, 0, 0,
+		0, 0, 0, 0,
+	)
+	a.trayHwnd = trayHwnd
+	a.remainingWindows++
+	a.registerTrayIcon(trayHwnd)
+	defer a.removeTrayIcon(trayHwnd)
+
+	a.keyboardHook = a.installKeyboardHook()
+	if a.keyboardHook != 0 {
+		defer procUnhookWindowsHookEx.Call(a.keyboardHook)
+	}
+
+	a.stopWatchdog = make(chan struct{})
+	go a.topmostWatchdog()
+	defer close(a.stopWatchdog)
+
+	var m msg
+	for {
+		r, _, _ := procGetMessage.Call(uintptr(unsafe.Pointer(&m)), 0, 0, 0)
+		if r == 0 {
+			break
+		}
+		procDispatchMessage.Call(uintptr(unsafe.Pointer(&m)))
+	}
+
+	return nil
+}
+
+func (a *App) registerTrayIcon(hwnd uintptr) {
+	var nid notifyIconData
+	nid.CbSize = uint32(unsafe.Sizeof(nid))
+	nid.Hwnd = hwnd
+	nid.UID = 1
+	nid.UFlags = nifMessage | nifTip
+	nid.UCallbackMessage = wmTrayNotify
+	copy(nid.SzTip[:], syscall.StringToUTF16("xwatermark"))
+
+	procShellNotifyIcon.Call(nimAdd, uintptr(unsafe.Pointer(&nid)))
+}
+
+func (a *App) removeTrayIcon(hwnd uintptr) {
+	var nid notifyIconData
+	nid.CbSize = uint32(unsafe.Sizeof(nid))
+	nid.Hwnd = hwnd
+	nid.UID = 1
+
+	procShellNotifyIcon.Call(nimDelete, uintptr(unsafe.Pointer(&nid)))
+}